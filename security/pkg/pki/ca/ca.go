@@ -17,6 +17,7 @@ package ca
 import (
 	"encoding/pem"
 	"fmt"
+	"sync"
 	"time"
 
 	apiv1 "k8s.io/api/core/v1"
@@ -36,11 +37,61 @@ const (
 	cACertID = "ca-cert.pem"
 	// cAPrivateKeyID is the private key file of CA.
 	cAPrivateKeyID = "ca-key.pem"
+	// certChainID is the file holding the issuing cert chain (intermediates, if any) to be
+	// served alongside a leaf certificate, matching the common cacerts/istio-ca-secret layout.
+	certChainID = "cert-chain.pem"
+	// rootCertID is the file holding the trust root.
+	rootCertID = "root-cert.pem"
 	// cASecret stores the key/cert of self-signed CA for persistency purpose.
 	cASecret = "istio-ca-secret"
 
+	// defaultSignerName is the SignerProfile used when CertOpts.CertSigner is unset, i.e. the
+	// single signer a non-multi-tenant IstioCA is configured with.
+	defaultSignerName = "default"
+
+	// signerSecretPrefix prefixes the per-signer secrets (cacerts-<signer>) mounted for a
+	// multi-tenant CA.
+	signerSecretPrefix = "cacerts-"
+
+	// defaultCertBackdate is how far before now an issued certificate's NotBefore is set by
+	// default, mirroring kube-controller-manager's signer. This tolerates workloads whose
+	// clocks run a little ahead of the CA's.
+	defaultCertBackdate = 5 * time.Minute
+
 	// The size of a private key for a self-signed Istio CA.
 	caKeySize = 2048
+
+	// caKeyTypeAnnotation records which KeyType the self-signed root was generated with, so a
+	// restart regenerates/reads the secret using the same algorithm.
+	caKeyTypeAnnotation = "ca.istio.io/key-type"
+)
+
+// KeyType is the public key algorithm used for a CA's signing key.
+type KeyType int
+
+const (
+	// RSA means the CA key is an RSA key (the default).
+	RSA KeyType = iota
+	// ECDSA means the CA key is an elliptic-curve key.
+	ECDSA
+)
+
+// String returns the string form of the KeyType, used for secret annotations.
+func (k KeyType) String() string {
+	if k == ECDSA {
+		return "ECDSA"
+	}
+	return "RSA"
+}
+
+// ECCCurve identifies the elliptic curve used when KeyType is ECDSA.
+type ECCCurve int
+
+const (
+	// P256 is the NIST P-256 curve.
+	P256 ECCCurve = iota
+	// P384 is the NIST P-384 curve.
+	P384
 )
 
 // cATypes is the enum for the CA type.
@@ -51,17 +102,56 @@ const (
 	selfSignedCA cATypes = iota
 	// PluggedCertCA means the Istio CA uses a operator-specified key/cert.
 	pluggedCertCA
+	// intermediateCA means the Istio CA's root cert is signed by an upstream CA it does not
+	// control (see NewIntermediateCAOptions). The self-signed root cert rotator assumes it owns
+	// the full chain up to the trust root, so it must never be attached to this CA type.
+	intermediateCA
 )
 
 // CertificateAuthority contains methods to be supported by a CA.
 type CertificateAuthority interface {
-	// Sign generates a certificate for a workload or CA, from the given CSR and TTL.
-	Sign(csrPEM []byte, ttl time.Duration) ([]byte, error)
+	// Sign generates a certificate for a workload or CA, from the given CSR and CertOpts.
+	Sign(csrPEM []byte, certOpts CertOpts) ([]byte, error)
+	// SignWithCertChain is like Sign, but also returns the full issuing chain: the first
+	// return value is the leaf cert followed by the chain (intermediates, then root), and the
+	// second is the chain alone (intermediates + root), so callers no longer need to concatenate
+	// GetCertChainPem() and GetRootCertPem() themselves.
+	SignWithCertChain(csrPEM []byte, certOpts CertOpts) ([]byte, [][]byte, error)
 	// SignCAServerCert generates a certificate for the CA server (to serve the CSR).
 	// TODO(myidpt): Remove this and add forCA in Sign().
 	SignCAServerCert(csrPEM []byte, ttl time.Duration) ([]byte, error)
-	// GetCAKeyCertBundle returns the KeyCertBundle used by CA.
-	GetCAKeyCertBundle() util.KeyCertBundle
+	// GetCAKeyCertBundle returns the KeyCertBundle used by CA. An optional signerName selects
+	// a specific signer profile on a multi-tenant CA; it is ignored by single-signer CAs.
+	GetCAKeyCertBundle(signerName ...string) util.KeyCertBundle
+}
+
+// CertOpts bundles the per-request options accepted by Sign.
+type CertOpts struct {
+	// CertSigner selects which SignerProfile should issue the certificate. Empty selects the
+	// default (and, for a non-multi-tenant CA, the only) signer.
+	CertSigner string
+	// TTL is the requested certificate validity duration.
+	TTL time.Duration
+	// ForCA requests a certificate with CA:TRUE in its X509v3 Basic Constraints.
+	ForCA bool
+	// SubjectIDs, when non-empty, is the list of SPIFFE/other identities the CSR's URI SANs
+	// must already contain; Sign rejects the request if any is missing. This lets a caller that
+	// authenticated the requester out-of-band (e.g. the RA, from the CSR submitter's identity)
+	// assert which identity the CSR is allowed to claim.
+	SubjectIDs []string
+}
+
+// SignerProfile holds the key/cert bundle and TTL policy for one named signer of a
+// (potentially multi-tenant) IstioCA.
+type SignerProfile struct {
+	// Name identifies the signer; it is matched against CertOpts.CertSigner.
+	Name string
+	// KeyCertBundle is the signing key/cert bundle for this signer.
+	KeyCertBundle util.KeyCertBundle
+	// MaxCertTTL is the longest TTL this signer will issue.
+	MaxCertTTL time.Duration
+	// ForCA means certs issued by this signer carry CA:TRUE by default.
+	ForCA bool
 }
 
 // IstioCAOptions holds the configurations for creating an Istio CA.
@@ -78,42 +168,74 @@ type IstioCAOptions struct {
 
 	LivenessProbeOptions *probe.Options
 	ProbeCheckInterval   time.Duration
+
+	// RotatorConfig configures the self-signed root cert rotator. Only used when CAType is
+	// selfSignedCA; nil disables automatic rotation. Rotation is never enabled for an
+	// intermediateCA, since the rotator assumes it owns the full chain up to the trust root.
+	RotatorConfig *RotatorConfig
+
+	// KeyType selects the public key algorithm for a newly generated self-signed root.
+	// Defaults to RSA.
+	KeyType KeyType
+	// ECCCurve selects the curve used when KeyType is ECDSA. Defaults to P256.
+	ECCCurve ECCCurve
+
+	// SignerProfiles, when set, turns the CA into a multi-tenant issuer: each profile is
+	// registered under its Name and selected via CertOpts.CertSigner. The bundle in
+	// KeyCertBundle/MaxCertTTL above is always registered as the "default" profile.
+	SignerProfiles []*SignerProfile
+
+	// Backdate is how far before now issued certificates' NotBefore is set, to tolerate
+	// workload clocks that run slightly ahead of the CA. Defaults to defaultCertBackdate.
+	Backdate time.Duration
 }
 
 // IstioCA generates keys and certificates for Istio identities.
 type IstioCA struct {
-	certTTL    time.Duration
-	maxCertTTL time.Duration
+	certTTL time.Duration
 
 	multicluster bool
 
-	keyCertBundle util.KeyCertBundle
+	mu             sync.RWMutex
+	signerProfiles map[string]*SignerProfile
+
+	// backdate is subtracted from clock() to compute an issued cert's NotBefore.
+	backdate time.Duration
+	// clock returns the current time; overridden in tests for deterministic TTL boundaries.
+	clock func() time.Time
 
 	livenessProbe *probe.Probe
+
+	rootCertRotator *SelfSignedCARootCertRotator
 }
 
 // NewSelfSignedIstioCAOptions returns a new IstioCAOptions instance using self-signed certificate.
 func NewSelfSignedIstioCAOptions(caCertTTL, certTTL, maxCertTTL time.Duration, multicluster bool, org string,
-	namespace string, core corev1.SecretsGetter) (caOpts *IstioCAOptions, err error) {
+	namespace string, core corev1.SecretsGetter, rotatorConfig *RotatorConfig, keyType KeyType, eccCurve ECCCurve) (caOpts *IstioCAOptions, err error) {
 	// For the first time the CA is up, it generates a self-signed key/cert pair and write it to
 	// cASecret. For subsequent restart, CA will reads key/cert from cASecret.
 	caSecret, scrtErr := core.Secrets(namespace).Get(cASecret, metav1.GetOptions{})
 	caOpts = &IstioCAOptions{
-		CAType:       selfSignedCA,
-		CertTTL:      certTTL,
-		MaxCertTTL:   maxCertTTL,
-		multicluster: multicluster,
+		CAType:        selfSignedCA,
+		CertTTL:       certTTL,
+		MaxCertTTL:    maxCertTTL,
+		multicluster:  multicluster,
+		RotatorConfig: rotatorConfig,
+		KeyType:       keyType,
+		ECCCurve:      eccCurve,
 	}
 	if scrtErr != nil {
 		log.Infof("Failed to get secret (error: %s), will create one", scrtErr)
 
 		options := util.CertOptions{
 			TTL:          caCertTTL,
+			NotBefore:    time.Now().Add(-defaultCertBackdate),
 			Org:          org,
 			IsCA:         true,
 			IsSelfSigned: true,
 			RSAKeySize:   caKeySize,
 		}
+		applyKeyType(&options, keyType, eccCurve)
 		pemCert, pemKey, ckErr := util.GenCertKeyFromOptions(options)
 		if ckErr != nil {
 			return nil, fmt.Errorf("unable to generate CA cert and key for self-signed CA (%v)", ckErr)
@@ -124,14 +246,20 @@ func NewSelfSignedIstioCAOptions(caCertTTL, certTTL, maxCertTTL time.Duration, m
 		}
 
 		// Rewrite the key/cert back to secret so they will be persistent when CA restarts.
+		// root-cert.pem always holds the trust root; cert-chain.pem is empty here since a
+		// self-signed root has no issuing chain above it (see NewIntermediateCAOptions).
 		secret := &apiv1.Secret{
 			Data: map[string][]byte{
 				cACertID:       pemCert,
 				cAPrivateKeyID: pemKey,
+				rootCertID:     pemCert,
 			},
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      cASecret,
 				Namespace: namespace,
+				Annotations: map[string]string{
+					caKeyTypeAnnotation: keyType.String(),
+				},
 			},
 			Type: istioCASecretType,
 		}
@@ -143,6 +271,133 @@ func NewSelfSignedIstioCAOptions(caCertTTL, certTTL, maxCertTTL time.Duration, m
 			caSecret.Data[cAPrivateKeyID], nil, caSecret.Data[cACertID]); err != nil {
 			return nil, fmt.Errorf("failed to create CA KeyCertBundle (%v)", err)
 		}
+		// Restore the key algorithm the secret was generated with, so a restart with different
+		// default flags does not cause a mismatch between caOpts.KeyType and the actual key.
+		if stored, ok := caSecret.Annotations[caKeyTypeAnnotation]; ok {
+			if stored == ECDSA.String() {
+				caOpts.KeyType = ECDSA
+			} else {
+				caOpts.KeyType = RSA
+			}
+		}
+	}
+
+	if rotatorConfig != nil {
+		// Keep the rotator in lockstep with the key algorithm actually in use, so a rotation
+		// regenerates the root with the same algorithm rather than silently falling back to RSA.
+		rotatorConfig.KeyType = caOpts.KeyType
+		rotatorConfig.ECCCurve = caOpts.ECCCurve
+	}
+
+	return caOpts, nil
+}
+
+// applyKeyType sets the key-algorithm fields on options based on keyType/eccCurve, leaving the
+// RSA defaults untouched when keyType is RSA.
+func applyKeyType(options *util.CertOptions, keyType KeyType, eccCurve ECCCurve) {
+	if keyType != ECDSA {
+		return
+	}
+	options.ECSigAlg = util.EcdsaSigAlg
+	if eccCurve == P384 {
+		options.ECCCurve = util.P384Curve
+	} else {
+		options.ECCCurve = util.P256Curve
+	}
+}
+
+// NewIntermediateCAOptions returns a new IstioCAOptions instance for an intermediate CA: on
+// first boot it generates an intermediate key/cert signed by the upstream root loaded from
+// upstreamSigningCertFile/upstreamSigningKeyFile/upstreamRootCertFile, and persists the
+// resulting chain (cert-chain.pem, root-cert.pem) to istio-ca-secret alongside the
+// intermediate's own ca-cert.pem/ca-key.pem. Subsequent restarts read the persisted chain.
+func NewIntermediateCAOptions(caCertTTL, certTTL, maxCertTTL time.Duration, multicluster bool, org string,
+	namespace string, core corev1.SecretsGetter, upstreamSigningCertFile, upstreamSigningKeyFile, upstreamRootCertFile string,
+	rotatorConfig *RotatorConfig, keyType KeyType, eccCurve ECCCurve) (caOpts *IstioCAOptions, err error) {
+	if rotatorConfig != nil {
+		log.Errorf("root cert rotation is not supported for an intermediate CA; ignoring the supplied RotatorConfig")
+		rotatorConfig = nil
+	}
+
+	caSecret, scrtErr := core.Secrets(namespace).Get(cASecret, metav1.GetOptions{})
+	caOpts = &IstioCAOptions{
+		CAType:        intermediateCA,
+		CertTTL:       certTTL,
+		MaxCertTTL:    maxCertTTL,
+		multicluster:  multicluster,
+		RotatorConfig: rotatorConfig,
+		KeyType:       keyType,
+		ECCCurve:      eccCurve,
+	}
+	if scrtErr != nil {
+		log.Infof("Failed to get secret (error: %s), will bootstrap an intermediate CA from the upstream root", scrtErr)
+
+		upstreamBundle, ubErr := util.NewVerifiedKeyCertBundleFromFile(
+			upstreamSigningCertFile, upstreamSigningKeyFile, "", upstreamRootCertFile)
+		if ubErr != nil {
+			return nil, fmt.Errorf("failed to load upstream root for intermediate CA (%v)", ubErr)
+		}
+		upstreamCert, upstreamKey, _, upstreamRootPem := upstreamBundle.GetAll()
+
+		options := util.CertOptions{
+			TTL:          caCertTTL,
+			NotBefore:    time.Now().Add(-defaultCertBackdate),
+			Org:          org,
+			IsCA:         true,
+			IsSelfSigned: false,
+			RSAKeySize:   caKeySize,
+		}
+		applyKeyType(&options, keyType, eccCurve)
+		csrPEM, pemKey, csrErr := util.GenCSR(options)
+		if csrErr != nil {
+			return nil, fmt.Errorf("unable to generate intermediate CA CSR (%v)", csrErr)
+		}
+		csr, csrParseErr := util.ParsePemEncodedCSR(csrPEM)
+		if csrParseErr != nil {
+			return nil, fmt.Errorf("unable to parse generated intermediate CA CSR (%v)", csrParseErr)
+		}
+		intermediateCertBytes, signErr := util.GenCertFromCSR(
+			csr, upstreamCert, csr.PublicKey, *upstreamKey, options.NotBefore, caCertTTL, true)
+		if signErr != nil {
+			return nil, fmt.Errorf("unable to sign intermediate CA cert with upstream root (%v)", signErr)
+		}
+		pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: intermediateCertBytes})
+
+		// certChainPem/rootCertPem must match what gets persisted below (certChainID: pemCert,
+		// rootCertID: upstreamRootPem) and what the restart path reads back, or
+		// GetCertChainPem()/GetRootCertPem() disagree with themselves across a restart.
+		if caOpts.KeyCertBundle, err = util.NewVerifiedKeyCertBundleFromPem(
+			pemCert, pemKey, pemCert, upstreamRootPem); err != nil {
+			return nil, fmt.Errorf("failed to create intermediate CA KeyCertBundle (%v)", err)
+		}
+
+		secret := &apiv1.Secret{
+			Data: map[string][]byte{
+				cACertID:       pemCert,
+				cAPrivateKeyID: pemKey,
+				certChainID:    pemCert,
+				rootCertID:     upstreamRootPem,
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      cASecret,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					caKeyTypeAnnotation: keyType.String(),
+				},
+			},
+			Type: istioCASecretType,
+		}
+		if _, err = core.Secrets(namespace).Create(secret); err != nil {
+			log.Errorf("Failed to write secret to CA (error: %s). This CA will not persist when restart.", err)
+		}
+	} else {
+		if caOpts.KeyCertBundle, err = util.NewVerifiedKeyCertBundleFromPem(caSecret.Data[cACertID],
+			caSecret.Data[cAPrivateKeyID], caSecret.Data[certChainID], caSecret.Data[rootCertID]); err != nil {
+			return nil, fmt.Errorf("failed to create intermediate CA KeyCertBundle (%v)", err)
+		}
+		if stored, ok := caSecret.Annotations[caKeyTypeAnnotation]; ok && stored == ECDSA.String() {
+			caOpts.KeyType = ECDSA
+		}
 	}
 
 	return caOpts, nil
@@ -165,37 +420,142 @@ func NewPluggedCertIstioCAOptions(certChainFile, signingCertFile, signingKeyFile
 }
 
 // NewIstioCA returns a new IstioCA instance.
-func NewIstioCA(opts *IstioCAOptions) (*IstioCA, error) {
+func NewIstioCA(opts *IstioCAOptions, core corev1.SecretsGetter) (*IstioCA, error) {
 	ca := &IstioCA{
-		certTTL:       opts.CertTTL,
-		maxCertTTL:    opts.MaxCertTTL,
-		keyCertBundle: opts.KeyCertBundle,
-		multicluster:  opts.multicluster,
+		certTTL:      opts.CertTTL,
+		multicluster: opts.multicluster,
+		signerProfiles: map[string]*SignerProfile{
+			defaultSignerName: {
+				Name:          defaultSignerName,
+				KeyCertBundle: opts.KeyCertBundle,
+				MaxCertTTL:    opts.MaxCertTTL,
+				ForCA:         opts.multicluster,
+			},
+		},
 		livenessProbe: probe.NewProbe(),
+		clock:         time.Now,
+	}
+	ca.backdate = opts.Backdate
+	if ca.backdate == 0 {
+		ca.backdate = defaultCertBackdate
+	}
+	for _, profile := range opts.SignerProfiles {
+		ca.signerProfiles[profile.Name] = profile
+	}
+
+	if opts.CAType == selfSignedCA && opts.RotatorConfig != nil {
+		ca.rootCertRotator = NewSelfSignedCARootCertRotator(opts.RotatorConfig, ca, core)
 	}
 
 	return ca, nil
 }
 
-// Sign takes a PEM-encoded CSR and returns a signed certificate. If the CA is a multicluster CA,
-// the signed certificate is a CA certificate (CA:TRUE in X509v3 Basic Constraints), otherwise, it is a workload
-// certificate.
-func (ca *IstioCA) Sign(csrPEM []byte, ttl time.Duration) ([]byte, error) {
-	return ca.sign(csrPEM, ttl, ca.multicluster)
+// LoadSignerProfilesFromSecrets builds one SignerProfile per signerName by reading the
+// corresponding cacerts-<signerName> secret from namespace. It is the multi-tenant counterpart
+// to the single istio-ca-secret read by NewSelfSignedIstioCAOptions/NewPluggedCertIstioCAOptions.
+func LoadSignerProfilesFromSecrets(core corev1.SecretsGetter, namespace string,
+	signerNames []string, maxCertTTL time.Duration) ([]*SignerProfile, error) {
+	profiles := make([]*SignerProfile, 0, len(signerNames))
+	for _, name := range signerNames {
+		secret, err := core.Secrets(namespace).Get(signerSecretPrefix+name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret for signer %q: %v", name, err)
+		}
+		bundle, err := util.NewVerifiedKeyCertBundleFromPem(
+			secret.Data[cACertID], secret.Data[cAPrivateKeyID], nil, secret.Data[cACertID])
+		if err != nil {
+			return nil, fmt.Errorf("failed to create KeyCertBundle for signer %q: %v", name, err)
+		}
+		profiles = append(profiles, &SignerProfile{
+			Name:          name,
+			KeyCertBundle: bundle,
+			MaxCertTTL:    maxCertTTL,
+		})
+	}
+	return profiles, nil
+}
+
+// signerProfile returns a snapshot of the named SignerProfile, or the default one if name is
+// empty. The snapshot is copied out while holding ca.mu, so callers can read its fields (in
+// particular KeyCertBundle) without racing the root cert rotator, which reassigns
+// ca.signerProfiles[name].KeyCertBundle under the same lock.
+func (ca *IstioCA) signerProfile(name string) (*SignerProfile, error) {
+	if name == "" {
+		name = defaultSignerName
+	}
+	ca.mu.RLock()
+	defer ca.mu.RUnlock()
+	profile, ok := ca.signerProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown cert signer %q", name)
+	}
+	snapshot := *profile
+	return &snapshot, nil
+}
+
+// Run starts the background tasks owned by the CA, such as the self-signed root cert rotator.
+// It is a no-op if the CA has no such tasks configured.
+func (ca *IstioCA) Run(stop <-chan struct{}) {
+	if ca.rootCertRotator != nil {
+		ca.rootCertRotator.Run(stop)
+	}
+}
+
+// Sign takes a PEM-encoded CSR and CertOpts and returns a signed certificate. The signer is
+// selected by certOpts.CertSigner (the default signer if empty); if the selected profile has
+// ForCA set (the default profile does on a multicluster CA) or certOpts.ForCA is set, the signed
+// certificate is a CA certificate (CA:TRUE in X509v3 Basic Constraints), otherwise it is a
+// workload certificate.
+func (ca *IstioCA) Sign(csrPEM []byte, certOpts CertOpts) ([]byte, error) {
+	profile, err := ca.signerProfile(certOpts.CertSigner)
+	if err != nil {
+		return nil, err
+	}
+	return ca.sign(profile, csrPEM, certOpts.TTL, certOpts.ForCA || profile.ForCA, certOpts.SubjectIDs)
+}
+
+// SignWithCertChain is like Sign, but also returns the signer's chain (intermediates + root),
+// sparing callers from concatenating GetCertChainPem() and GetRootCertPem() themselves.
+func (ca *IstioCA) SignWithCertChain(csrPEM []byte, certOpts CertOpts) ([]byte, [][]byte, error) {
+	leafPEM, err := ca.Sign(csrPEM, certOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	profile, err := ca.signerProfile(certOpts.CertSigner)
+	if err != nil {
+		return nil, nil, err
+	}
+	chain := [][]byte{profile.KeyCertBundle.GetCertChainPem(), profile.KeyCertBundle.GetRootCertPem()}
+	fullChain := append(append([]byte{}, leafPEM...), chain[0]...)
+	fullChain = append(fullChain, chain[1]...)
+	return fullChain, chain, nil
 }
 
 // SignCAServerCert signs the certificate for the Istio CA server (to serve the CSR, etc).
 func (ca *IstioCA) SignCAServerCert(csrPEM []byte, ttl time.Duration) ([]byte, error) {
-	return ca.sign(csrPEM, ttl, false)
+	profile, err := ca.signerProfile(defaultSignerName)
+	if err != nil {
+		return nil, err
+	}
+	return ca.sign(profile, csrPEM, ttl, false, nil)
 }
 
-// GetCAKeyCertBundle returns the KeyCertBundle for the CA.
-func (ca *IstioCA) GetCAKeyCertBundle() util.KeyCertBundle {
-	return ca.keyCertBundle
+// GetCAKeyCertBundle returns the KeyCertBundle for the given signer, or the default signer's
+// bundle if no signerName is given.
+func (ca *IstioCA) GetCAKeyCertBundle(signerName ...string) util.KeyCertBundle {
+	name := ""
+	if len(signerName) > 0 {
+		name = signerName[0]
+	}
+	profile, err := ca.signerProfile(name)
+	if err != nil {
+		return nil
+	}
+	return profile.KeyCertBundle
 }
 
-func (ca *IstioCA) sign(csrPEM []byte, ttl time.Duration, forCA bool) ([]byte, error) {
-	signingCert, signingKey, _, _ := ca.keyCertBundle.GetAll()
+func (ca *IstioCA) sign(profile *SignerProfile, csrPEM []byte, ttl time.Duration, forCA bool, subjectIDs []string) ([]byte, error) {
+	signingCert, signingKey, _, _ := profile.KeyCertBundle.GetAll()
 	if signingCert == nil {
 		return nil, fmt.Errorf("Istio CA is not ready") // nolint
 	}
@@ -205,13 +565,18 @@ func (ca *IstioCA) sign(csrPEM []byte, ttl time.Duration, forCA bool) ([]byte, e
 		return nil, err
 	}
 
-	// If the requested TTL is greater than maxCertTTL, return an error
-	if ttl.Seconds() > ca.maxCertTTL.Seconds() {
+	if err := util.VerifySubjectIDs(csr, subjectIDs); err != nil {
+		return nil, err
+	}
+
+	// If the requested TTL is greater than the signer's maxCertTTL, return an error
+	if ttl.Seconds() > profile.MaxCertTTL.Seconds() {
 		return nil, fmt.Errorf(
-			"requested TTL %s is greater than the max allowed TTL %s", ttl, ca.maxCertTTL)
+			"requested TTL %s is greater than the max allowed TTL %s", ttl, profile.MaxCertTTL)
 	}
 
-	certBytes, err := util.GenCertFromCSR(csr, signingCert, csr.PublicKey, *signingKey, ttl, forCA)
+	notBefore := ca.clock().Add(-ca.backdate)
+	certBytes, err := util.GenCertFromCSR(csr, signingCert, csr.PublicKey, *signingKey, notBefore, ttl, forCA)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,140 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// writeTempPem writes pemBytes to a new temp file and returns its path, registering cleanup.
+func writeTempPem(t *testing.T, pemBytes []byte) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "ca-intermediate-test-")
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(pemBytes); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	return f.Name()
+}
+
+// newUpstreamRootFiles generates a self-signed upstream root CA and returns paths to its
+// cert/key, suitable for upstreamSigningCertFile/upstreamSigningKeyFile/upstreamRootCertFile.
+func newUpstreamRootFiles(t *testing.T) (certFile, keyFile string, rootPem []byte) {
+	t.Helper()
+	pemCert, pemKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		TTL:          time.Hour,
+		Org:          "upstream.istio.io",
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate upstream root cert: %v", err)
+	}
+	return writeTempPem(t, pemCert), writeTempPem(t, pemKey), pemCert
+}
+
+// parseLeafAndChain splits a leaf+chain PEM blob (as returned by SignWithCertChain) back into
+// its individual certificates.
+func parseLeafAndChain(t *testing.T, fullChainPEM []byte) []*x509.Certificate {
+	t.Helper()
+	var certs []*x509.Certificate
+	rest := fullChainPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatalf("failed to parse cert in chain: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	return certs
+}
+
+// TestIntermediateCABootstrapThenRestartSignsConsistentChain regression-tests the first-boot
+// intermediate CA bundle matching what gets persisted and read back: SignWithCertChain must
+// return leaf+intermediate+root both immediately after bootstrap and after a simulated restart.
+func TestIntermediateCABootstrapThenRestartSignsConsistentChain(t *testing.T) {
+	upstreamCertFile, upstreamKeyFile, upstreamRootPem := newUpstreamRootFiles(t)
+	core := fake.NewSimpleClientset()
+
+	bootstrapOpts, err := NewIntermediateCAOptions(time.Hour, time.Hour, time.Hour, false, "test.istio.io",
+		testNamespace, core.CoreV1(), upstreamCertFile, upstreamKeyFile, upstreamCertFile, nil, RSA, P256)
+	if err != nil {
+		t.Fatalf("NewIntermediateCAOptions() bootstrap failed: %v", err)
+	}
+	bootstrapCA, err := NewIstioCA(bootstrapOpts, core.CoreV1())
+	if err != nil {
+		t.Fatalf("NewIstioCA() failed: %v", err)
+	}
+
+	checkSignedChain := func(t *testing.T, ca *IstioCA) {
+		t.Helper()
+		fullChainPEM, chain, err := ca.SignWithCertChain(testCSR(t), CertOpts{TTL: time.Minute})
+		if err != nil {
+			t.Fatalf("SignWithCertChain() failed: %v", err)
+		}
+		if len(chain) != 2 {
+			t.Fatalf("chain has %d certs, want 2 (intermediate + root)", len(chain))
+		}
+		if string(chain[1]) != string(upstreamRootPem) {
+			t.Error("chain's root does not match the upstream root")
+		}
+
+		certs := parseLeafAndChain(t, fullChainPEM)
+		if len(certs) != 3 {
+			t.Fatalf("full chain has %d certs, want 3 (leaf + intermediate + root)", len(certs))
+		}
+		leaf, intermediate, root := certs[0], certs[1], certs[2]
+		if err := leaf.CheckSignatureFrom(intermediate); err != nil {
+			t.Errorf("leaf was not signed by the intermediate: %v", err)
+		}
+		if err := intermediate.CheckSignatureFrom(root); err != nil {
+			t.Errorf("intermediate was not signed by the upstream root: %v", err)
+		}
+	}
+
+	checkSignedChain(t, bootstrapCA)
+
+	// Simulate a restart: re-run NewIntermediateCAOptions against the now-populated secret.
+	restartOpts, err := NewIntermediateCAOptions(time.Hour, time.Hour, time.Hour, false, "test.istio.io",
+		testNamespace, core.CoreV1(), upstreamCertFile, upstreamKeyFile, upstreamCertFile, nil, RSA, P256)
+	if err != nil {
+		t.Fatalf("NewIntermediateCAOptions() restart failed: %v", err)
+	}
+	restartCA, err := NewIstioCA(restartOpts, core.CoreV1())
+	if err != nil {
+		t.Fatalf("NewIstioCA() failed: %v", err)
+	}
+
+	checkSignedChain(t, restartCA)
+}
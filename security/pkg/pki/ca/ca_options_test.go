@@ -0,0 +1,77 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/ecdsa"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func TestNewSelfSignedIstioCAOptionsGeneratesECDSAKey(t *testing.T) {
+	core := fake.NewSimpleClientset()
+	caOpts, err := NewSelfSignedIstioCAOptions(time.Hour, time.Hour, time.Hour, false, "test.istio.io",
+		testNamespace, core.CoreV1(), nil, ECDSA, P256)
+	if err != nil {
+		t.Fatalf("NewSelfSignedIstioCAOptions() failed: %v", err)
+	}
+
+	cert, _, _, _ := caOpts.KeyCertBundle.GetAll()
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+		t.Errorf("expected an ECDSA public key, got %T", cert.PublicKey)
+	}
+
+	secret, err := core.CoreV1().Secrets(testNamespace).Get(cASecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to read back secret: %v", err)
+	}
+	if secret.Annotations[caKeyTypeAnnotation] != ECDSA.String() {
+		t.Errorf("caKeyTypeAnnotation = %q, want %q", secret.Annotations[caKeyTypeAnnotation], ECDSA.String())
+	}
+}
+
+func TestNewSelfSignedIstioCAOptionsRestoresKeyTypeFromAnnotation(t *testing.T) {
+	ecdsaOptions := util.CertOptions{
+		TTL:          time.Hour,
+		Org:          "test.istio.io",
+		IsCA:         true,
+		IsSelfSigned: true,
+	}
+	applyKeyType(&ecdsaOptions, ECDSA, P256)
+	pemCert, pemKey, err := util.GenCertKeyFromOptions(ecdsaOptions)
+	if err != nil {
+		t.Fatalf("failed to generate ECDSA test root: %v", err)
+	}
+
+	secret := newTestSecret(pemCert, pemKey)
+	secret.Annotations[caKeyTypeAnnotation] = ECDSA.String()
+	core := fake.NewSimpleClientset(secret)
+
+	// A restart that defaults to RSA should still pick up the ECDSA key the secret was created
+	// with, rather than mismatching caOpts.KeyType against the actual key in the bundle.
+	caOpts, err := NewSelfSignedIstioCAOptions(time.Hour, time.Hour, time.Hour, false, "test.istio.io",
+		testNamespace, core.CoreV1(), nil, RSA, P256)
+	if err != nil {
+		t.Fatalf("NewSelfSignedIstioCAOptions() failed: %v", err)
+	}
+	if caOpts.KeyType != ECDSA {
+		t.Errorf("caOpts.KeyType = %v, want %v", caOpts.KeyType, ECDSA)
+	}
+}
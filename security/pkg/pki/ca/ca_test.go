@@ -0,0 +1,225 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/url"
+	"testing"
+	"time"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// newTestIstioCA returns an IstioCA with a self-signed default profile, a fixed clock and the
+// given backdate, for deterministic TTL boundary testing.
+func newTestIstioCA(t *testing.T, now time.Time, backdate time.Duration, maxCertTTL time.Duration) *IstioCA {
+	t.Helper()
+	pemCert, pemKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		TTL:          time.Hour,
+		Org:          "test.istio.io",
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate test CA cert: %v", err)
+	}
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(pemCert, pemKey, nil, pemCert)
+	if err != nil {
+		t.Fatalf("failed to build test KeyCertBundle: %v", err)
+	}
+
+	return &IstioCA{
+		signerProfiles: map[string]*SignerProfile{
+			defaultSignerName: {
+				Name:          defaultSignerName,
+				KeyCertBundle: bundle,
+				MaxCertTTL:    maxCertTTL,
+			},
+		},
+		backdate: backdate,
+		clock:    func() time.Time { return now },
+	}
+}
+
+func testCSR(t *testing.T) []byte {
+	t.Helper()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Org: "test.istio.io", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatalf("failed to generate test CSR: %v", err)
+	}
+	return csrPEM
+}
+
+// testCSRWithURIs builds a CSR carrying the given URI SANs. util.GenCSR has no URIs option, so
+// this builds the x509.CertificateRequest directly, the same way GenCSR does internally.
+func testCSRWithURIs(t *testing.T, uris ...string) []byte {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %v", err)
+	}
+	template := &x509.CertificateRequest{}
+	for _, u := range uris {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			t.Fatalf("failed to parse URI %q: %v", u, err)
+		}
+		template.URIs = append(template.URIs, parsed)
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		t.Fatalf("failed to create test CSR: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+}
+
+func TestSignBackdatesNotBeforeFromMockedClock(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	backdate := 5 * time.Minute
+	ca := newTestIstioCA(t, now, backdate, time.Hour)
+
+	certPEM, err := ca.Sign(testCSR(t), CertOpts{TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse signed cert: %v", err)
+	}
+
+	wantNotBefore := now.Add(-backdate)
+	if !cert.NotBefore.Equal(wantNotBefore) {
+		t.Errorf("NotBefore = %v, want %v", cert.NotBefore, wantNotBefore)
+	}
+}
+
+func TestSignTTLBoundary(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	maxCertTTL := time.Hour
+
+	tests := []struct {
+		name    string
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{name: "ttl equal to max is allowed", ttl: maxCertTTL, wantErr: false},
+		{name: "ttl one second over max is rejected", ttl: maxCertTTL + time.Second, wantErr: true},
+		{name: "ttl well under max is allowed", ttl: time.Minute, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca := newTestIstioCA(t, now, 0, maxCertTTL)
+			_, err := ca.Sign(testCSR(t), CertOpts{TTL: tt.ttl})
+			if tt.wantErr && err == nil {
+				t.Errorf("Sign() with TTL %v: expected error, got none", tt.ttl)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Sign() with TTL %v: unexpected error: %v", tt.ttl, err)
+			}
+		})
+	}
+}
+
+// newOtherSignerBundle generates a distinct self-signed CA bundle, so tests can tell which
+// profile actually signed a cert by comparing issuers.
+func newOtherSignerBundle(t *testing.T) util.KeyCertBundle {
+	t.Helper()
+	pemCert, pemKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		TTL:          time.Hour,
+		Org:          "other.istio.io",
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate other signer's CA cert: %v", err)
+	}
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(pemCert, pemKey, nil, pemCert)
+	if err != nil {
+		t.Fatalf("failed to build other signer's KeyCertBundle: %v", err)
+	}
+	return bundle
+}
+
+func TestSignRoutesToNamedSigner(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ca := newTestIstioCA(t, now, 0, time.Hour)
+	otherBundle := newOtherSignerBundle(t)
+	ca.signerProfiles["other"] = &SignerProfile{
+		Name:          "other",
+		KeyCertBundle: otherBundle,
+		MaxCertTTL:    time.Hour,
+	}
+
+	certPEM, err := ca.Sign(testCSR(t), CertOpts{CertSigner: "other", TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse signed cert: %v", err)
+	}
+
+	otherSigningCert, _, _, _ := otherBundle.GetAll()
+	if err := cert.CheckSignatureFrom(otherSigningCert); err != nil {
+		t.Errorf("cert issued with CertSigner \"other\" was not signed by the other profile's key: %v", err)
+	}
+}
+
+func TestSignUnknownCertSigner(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ca := newTestIstioCA(t, now, 0, time.Hour)
+
+	_, err := ca.Sign(testCSR(t), CertOpts{CertSigner: "does-not-exist", TTL: time.Minute})
+	if err == nil {
+		t.Fatal("Sign() with an unknown CertSigner: expected error, got none")
+	}
+	const wantErr = `unknown cert signer "does-not-exist"`
+	if err.Error() != wantErr {
+		t.Errorf("Sign() error = %q, want %q", err.Error(), wantErr)
+	}
+}
+
+func TestSignEnforcesSubjectIDs(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	const allowedID = "spiffe://cluster.local/ns/default/sa/foo"
+
+	t.Run("CSR contains every requested subject ID", func(t *testing.T) {
+		ca := newTestIstioCA(t, now, 0, time.Hour)
+		_, err := ca.Sign(testCSRWithURIs(t, allowedID), CertOpts{TTL: time.Minute, SubjectIDs: []string{allowedID}})
+		if err != nil {
+			t.Errorf("Sign() failed: %v", err)
+		}
+	})
+
+	t.Run("CSR is missing a requested subject ID", func(t *testing.T) {
+		ca := newTestIstioCA(t, now, 0, time.Hour)
+		_, err := ca.Sign(testCSRWithURIs(t, "spiffe://cluster.local/ns/default/sa/bar"),
+			CertOpts{TTL: time.Minute, SubjectIDs: []string{allowedID}})
+		if err == nil {
+			t.Error("Sign() with a CSR missing the requested subject ID: expected error, got none")
+		}
+	})
+}
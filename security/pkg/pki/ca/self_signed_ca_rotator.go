@@ -0,0 +1,199 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+
+	"istio.io/istio/pkg/log"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+// RotatorConfig holds the configuration for the self-signed CA root cert rotator.
+type RotatorConfig struct {
+	// CheckInterval is how often the rotator checks the root cert for expiry.
+	CheckInterval time.Duration
+	// GracePeriodRatio is the fraction of the root cert's total lifetime remaining at which
+	// rotation is triggered, e.g. 0.2 rotates once 20% of the validity period remains.
+	GracePeriodRatio float64
+	// RetryInterval is how long to wait before retrying a failed rotation attempt.
+	RetryInterval time.Duration
+
+	CaCertTTL time.Duration
+	Org       string
+	Namespace string
+
+	// KeyType selects the public key algorithm for the rotated root. Must match the algorithm
+	// the CA was originally created with, or the rotated root silently changes key type.
+	KeyType KeyType
+	// ECCCurve selects the curve used when KeyType is ECDSA.
+	ECCCurve ECCCurve
+
+	// OnRootCertUpdate is invoked with the newly rotated bundle after a successful rotation,
+	// so that dependent components (e.g. discovery) can push the new root cert.
+	OnRootCertUpdate func(bundle util.KeyCertBundle)
+}
+
+// SelfSignedCARootCertRotator periodically checks the self-signed root cert stored in the
+// istio-ca-secret and rotates it in place once it is within its grace period of expiry.
+type SelfSignedCARootCertRotator struct {
+	config *RotatorConfig
+	core   corev1.SecretsGetter
+
+	mutex sync.Mutex
+
+	ca *IstioCA
+}
+
+// NewSelfSignedCARootCertRotator creates a new rotator for the given CA and config.
+func NewSelfSignedCARootCertRotator(config *RotatorConfig, ca *IstioCA, core corev1.SecretsGetter) *SelfSignedCARootCertRotator {
+	return &SelfSignedCARootCertRotator{
+		config: config,
+		core:   core,
+		ca:     ca,
+	}
+}
+
+// Run starts the root cert rotator, checking on CheckInterval until stop is closed. A failed
+// check/rotation is retried after RetryInterval instead of waiting for the next regular tick,
+// which may be much further out (e.g. a 24h CheckInterval with a transient API error).
+func (rotator *SelfSignedCARootCertRotator) Run(stop <-chan struct{}) {
+	go func() {
+		ticker := time.NewTicker(rotator.config.CheckInterval)
+		defer ticker.Stop()
+
+		retryTimer := time.NewTimer(rotator.config.RetryInterval)
+		retryTimer.Stop()
+		defer retryTimer.Stop()
+
+		attempt := func() {
+			if err := rotator.checkAndRotateRootCert(); err != nil {
+				log.Errorf("root cert check and rotation failed, will retry in %v: %v", rotator.config.RetryInterval, err)
+				retryTimer.Reset(rotator.config.RetryInterval)
+			}
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				attempt()
+			case <-retryTimer.C:
+				attempt()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// checkAndRotateRootCert rereads the istio-ca-secret under lock, compares it against the
+// in-memory KeyCertBundle, and rotates the root if it is within its grace period of expiry.
+// On multi-replica deployments, only the replica whose copy of the root is still authoritative
+// performs the rotation; other replicas simply reload the secret's contents into their bundle.
+func (rotator *SelfSignedCARootCertRotator) checkAndRotateRootCert() error {
+	rotator.mutex.Lock()
+	defer rotator.mutex.Unlock()
+
+	caSecret, scrtErr := rotator.core.Secrets(rotator.config.Namespace).Get(cASecret, metav1.GetOptions{})
+	if scrtErr != nil {
+		return scrtErr
+	}
+
+	defaultProfile, err := rotator.ca.signerProfile(defaultSignerName)
+	if err != nil {
+		return err
+	}
+	rootCertPem := defaultProfile.KeyCertBundle.GetRootCertPem()
+	if !bytes.Equal(rootCertPem, caSecret.Data[cACertID]) {
+		// Another replica already rotated the secret; adopt its copy instead of rotating again.
+		return rotator.reloadRootCertFromSecret(caSecret)
+	}
+
+	needsRotation, err := util.IsWithinGracePeriod(rootCertPem, rotator.config.GracePeriodRatio)
+	if err != nil {
+		return err
+	}
+	if !needsRotation {
+		return nil
+	}
+
+	return rotator.rotateRootCert(caSecret)
+}
+
+// reloadRootCertFromSecret loads a root cert/key that was rotated by another replica into
+// this replica's in-memory bundle.
+func (rotator *SelfSignedCARootCertRotator) reloadRootCertFromSecret(caSecret *apiv1.Secret) error {
+	newBundle, err := util.NewVerifiedKeyCertBundleFromPem(
+		caSecret.Data[cACertID], caSecret.Data[cAPrivateKeyID], nil, caSecret.Data[cACertID])
+	if err != nil {
+		return err
+	}
+	rotator.ca.mu.Lock()
+	rotator.ca.signerProfiles[defaultSignerName].KeyCertBundle = newBundle
+	rotator.ca.mu.Unlock()
+	if rotator.config.OnRootCertUpdate != nil {
+		rotator.config.OnRootCertUpdate(newBundle)
+	}
+	return nil
+}
+
+// rotateRootCert generates a new self-signed root, rewrites the secret, and updates the
+// in-memory bundle.
+func (rotator *SelfSignedCARootCertRotator) rotateRootCert(caSecret *apiv1.Secret) error {
+	options := util.CertOptions{
+		TTL:          rotator.config.CaCertTTL,
+		NotBefore:    time.Now().Add(-defaultCertBackdate),
+		Org:          rotator.config.Org,
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   caKeySize,
+	}
+	applyKeyType(&options, rotator.config.KeyType, rotator.config.ECCCurve)
+	pemCert, pemKey, err := util.GenCertKeyFromOptions(options)
+	if err != nil {
+		return err
+	}
+
+	newBundle, err := util.NewVerifiedKeyCertBundleFromPem(pemCert, pemKey, nil, pemCert)
+	if err != nil {
+		return err
+	}
+
+	caSecret.Data[cACertID] = pemCert
+	caSecret.Data[cAPrivateKeyID] = pemKey
+	caSecret.Data[rootCertID] = pemCert
+	if caSecret.Annotations == nil {
+		caSecret.Annotations = map[string]string{}
+	}
+	caSecret.Annotations[caKeyTypeAnnotation] = rotator.config.KeyType.String()
+	if _, err := rotator.core.Secrets(rotator.config.Namespace).Update(caSecret); err != nil {
+		return err
+	}
+
+	rotator.ca.mu.Lock()
+	rotator.ca.signerProfiles[defaultSignerName].KeyCertBundle = newBundle
+	rotator.ca.mu.Unlock()
+	log.Infof("self-signed CA root cert rotated, next check in %v", rotator.config.CheckInterval)
+	if rotator.config.OnRootCertUpdate != nil {
+		rotator.config.OnRootCertUpdate(newBundle)
+	}
+	return nil
+}
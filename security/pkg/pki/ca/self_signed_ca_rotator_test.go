@@ -0,0 +1,156 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ca
+
+import (
+	"testing"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const testNamespace = "istio-system"
+
+// newTestSecret builds the istio-ca-secret fake object backing pemCert/pemKey.
+func newTestSecret(pemCert, pemKey []byte) *apiv1.Secret {
+	return &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cASecret,
+			Namespace: testNamespace,
+			Annotations: map[string]string{
+				caKeyTypeAnnotation: RSA.String(),
+			},
+		},
+		Data: map[string][]byte{
+			cACertID:       pemCert,
+			cAPrivateKeyID: pemKey,
+			rootCertID:     pemCert,
+		},
+		Type: istioCASecretType,
+	}
+}
+
+// newRootCert generates a self-signed root valid for ttl, backdated so that only
+// remainingFraction of its lifetime is left.
+func newRootCert(t *testing.T, ttl time.Duration, remainingFraction float64) (pemCert, pemKey []byte) {
+	t.Helper()
+	elapsed := time.Duration(float64(ttl) * (1 - remainingFraction))
+	pemCert, pemKey, err := util.GenCertKeyFromOptions(util.CertOptions{
+		TTL:          ttl,
+		NotBefore:    time.Now().Add(-elapsed),
+		Org:          "test.istio.io",
+		IsCA:         true,
+		IsSelfSigned: true,
+		RSAKeySize:   2048,
+	})
+	if err != nil {
+		t.Fatalf("failed to generate test root cert: %v", err)
+	}
+	return pemCert, pemKey
+}
+
+func newTestRotator(t *testing.T, pemCert, pemKey []byte, core *fake.Clientset, gracePeriodRatio float64) *SelfSignedCARootCertRotator {
+	t.Helper()
+	bundle, err := util.NewVerifiedKeyCertBundleFromPem(pemCert, pemKey, nil, pemCert)
+	if err != nil {
+		t.Fatalf("failed to build test KeyCertBundle: %v", err)
+	}
+	istioCA := &IstioCA{
+		signerProfiles: map[string]*SignerProfile{
+			defaultSignerName: {Name: defaultSignerName, KeyCertBundle: bundle},
+		},
+	}
+	config := &RotatorConfig{
+		CheckInterval:    time.Minute,
+		GracePeriodRatio: gracePeriodRatio,
+		RetryInterval:    time.Second,
+		CaCertTTL:        time.Hour,
+		Org:              "test.istio.io",
+		Namespace:        testNamespace,
+		KeyType:          RSA,
+	}
+	return NewSelfSignedCARootCertRotator(config, istioCA, core.CoreV1())
+}
+
+func TestCheckAndRotateRootCertWithinGracePeriod(t *testing.T) {
+	pemCert, pemKey := newRootCert(t, time.Hour, 0.05)
+	core := fake.NewSimpleClientset(newTestSecret(pemCert, pemKey))
+	rotator := newTestRotator(t, pemCert, pemKey, core, 0.2)
+
+	if err := rotator.checkAndRotateRootCert(); err != nil {
+		t.Fatalf("checkAndRotateRootCert() failed: %v", err)
+	}
+
+	updated, err := core.CoreV1().Secrets(testNamespace).Get(cASecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to read back secret: %v", err)
+	}
+	if string(updated.Data[cACertID]) == string(pemCert) {
+		t.Error("expected the root cert to be rotated, but the secret is unchanged")
+	}
+
+	newBundle := rotator.ca.signerProfiles[defaultSignerName].KeyCertBundle
+	if string(newBundle.GetRootCertPem()) == string(pemCert) {
+		t.Error("expected the in-memory bundle to reflect the rotated root")
+	}
+}
+
+func TestCheckAndRotateRootCertOutsideGracePeriod(t *testing.T) {
+	pemCert, pemKey := newRootCert(t, time.Hour, 0.9)
+	core := fake.NewSimpleClientset(newTestSecret(pemCert, pemKey))
+	rotator := newTestRotator(t, pemCert, pemKey, core, 0.2)
+
+	if err := rotator.checkAndRotateRootCert(); err != nil {
+		t.Fatalf("checkAndRotateRootCert() failed: %v", err)
+	}
+
+	updated, err := core.CoreV1().Secrets(testNamespace).Get(cASecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to read back secret: %v", err)
+	}
+	if string(updated.Data[cACertID]) != string(pemCert) {
+		t.Error("root cert was rotated while still outside its grace period")
+	}
+}
+
+func TestCheckAndRotateRootCertAdoptsReplicaRotatedSecret(t *testing.T) {
+	staleCert, staleKey := newRootCert(t, time.Hour, 0.9)
+	freshCert, freshKey := newRootCert(t, time.Hour, 0.9)
+	// The secret (as another replica already rewrote it) holds freshCert, but this replica's
+	// in-memory bundle still has staleCert.
+	core := fake.NewSimpleClientset(newTestSecret(freshCert, freshKey))
+	rotator := newTestRotator(t, staleCert, staleKey, core, 0.2)
+
+	if err := rotator.checkAndRotateRootCert(); err != nil {
+		t.Fatalf("checkAndRotateRootCert() failed: %v", err)
+	}
+
+	newBundle := rotator.ca.signerProfiles[defaultSignerName].KeyCertBundle
+	if string(newBundle.GetRootCertPem()) != string(freshCert) {
+		t.Error("expected the in-memory bundle to be reloaded from the secret another replica rotated")
+	}
+
+	updated, err := core.CoreV1().Secrets(testNamespace).Get(cASecret, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to read back secret: %v", err)
+	}
+	if string(updated.Data[cACertID]) != string(freshCert) {
+		t.Error("the secret should not have been rewritten by a replica that only reloaded it")
+	}
+}
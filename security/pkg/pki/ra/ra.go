@@ -0,0 +1,185 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ra implements a RegistrationAuthority that delegates certificate signing to the
+// Kubernetes CertificateSigningRequest API, rather than signing locally with an in-memory key.
+// This allows an external signer (cert-manager, AWS PCA, Vault, etc.) registered under a
+// signerName to act as the actual issuer.
+package ra
+
+import (
+	"fmt"
+	"time"
+
+	certv1beta1 "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	certclient "k8s.io/client-go/kubernetes/typed/certificates/v1beta1"
+
+	"istio.io/istio/pkg/log"
+	"istio.io/istio/security/pkg/pki/ca"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+const (
+	// pollInterval is how often the RA polls a submitted CSR for approval/issuance.
+	pollInterval = 500 * time.Millisecond
+	// pollTimeout is how long the RA waits for a CSR to be approved and signed.
+	pollTimeout = 60 * time.Second
+)
+
+// RegistrationAuthorityOptions holds the configuration needed to construct a RegistrationAuthority.
+type RegistrationAuthorityOptions struct {
+	// SignerName is the Kubernetes CertificateSigningRequest signerName this RA submits
+	// CSRs under, e.g. "example.com/istio-workload".
+	SignerName string
+	// CertSignerDomain is the domain used to qualify a per-request CertSigner into a
+	// fully-qualified signerName, allowing callers to request certs from different backends.
+	CertSignerDomain string
+
+	TrustedRootCertPem []byte
+}
+
+// RegistrationAuthority implements the ca.CertificateAuthority interface by delegating CSR
+// signing to the Kubernetes CertificateSigningRequest API.
+type RegistrationAuthority struct {
+	signerName       string
+	certSignerDomain string
+	csrClient        certclient.CertificateSigningRequestInterface
+
+	keyCertBundle util.KeyCertBundle
+}
+
+// NewRegistrationAuthority returns a new RegistrationAuthority that submits CSRs to the
+// Kubernetes API under the given options.
+func NewRegistrationAuthority(opts *RegistrationAuthorityOptions, csrClient certclient.CertificateSigningRequestInterface) (*RegistrationAuthority, error) {
+	keyCertBundle, err := util.NewVerifiedKeyCertBundleFromPem(nil, nil, nil, opts.TrustedRootCertPem)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RA trust bundle (%v)", err)
+	}
+	return &RegistrationAuthority{
+		signerName:       opts.SignerName,
+		certSignerDomain: opts.CertSignerDomain,
+		csrClient:        csrClient,
+		keyCertBundle:    keyCertBundle,
+	}, nil
+}
+
+// Sign submits the CSR to Kubernetes as a CertificateSigningRequest and blocks until it is
+// approved and issued, returning the resulting cert chain. certOpts.CertSigner selects which
+// backend signer should service the request, enabling per-namespace or per-workload policy;
+// an empty CertSigner uses the RA's configured default signerName.
+func (ra *RegistrationAuthority) Sign(csrPEM []byte, certOpts ca.CertOpts) ([]byte, error) {
+	if len(certOpts.SubjectIDs) > 0 {
+		csr, err := util.ParsePemEncodedCSR(csrPEM)
+		if err != nil {
+			return nil, err
+		}
+		if err := util.VerifySubjectIDs(csr, certOpts.SubjectIDs); err != nil {
+			return nil, err
+		}
+	}
+
+	signerName := ra.signerName
+	if certOpts.CertSigner != "" {
+		signerName = ra.certSignerDomain + "/" + certOpts.CertSigner
+	}
+
+	csr := &certv1beta1.CertificateSigningRequest{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: "istio-ra-",
+		},
+		Spec: certv1beta1.CertificateSigningRequestSpec{
+			Request: csrPEM,
+			Usages: []certv1beta1.KeyUsage{
+				certv1beta1.UsageDigitalSignature,
+				certv1beta1.UsageKeyEncipherment,
+				certv1beta1.UsageClientAuth,
+			},
+			SignerName:        &signerName,
+			ExpirationSeconds: int32Ptr(int32(certOpts.TTL.Seconds())),
+		},
+	}
+
+	created, err := ra.csrClient.Create(csr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CertificateSigningRequest: %v", err)
+	}
+	defer ra.deleteCSR(created.Name)
+
+	return ra.waitForCertificate(created.Name)
+}
+
+// deleteCSR removes the named CertificateSigningRequest once the RA is done with it, so issued
+// certs don't leave a permanent object behind in the cluster. Failure is non-fatal: the CSR is
+// harmless garbage at that point, not a reason to fail the Sign call that already has its result.
+func (ra *RegistrationAuthority) deleteCSR(name string) {
+	if err := ra.csrClient.Delete(name, &metav1.DeleteOptions{}); err != nil {
+		log.Warnf("failed to delete CertificateSigningRequest %s: %v", name, err)
+	}
+}
+
+// SignWithCertChain is like Sign, but also returns the RA's trust chain (just the root, since
+// the Kubernetes CSR API does not expose any intermediates it used).
+func (ra *RegistrationAuthority) SignWithCertChain(csrPEM []byte, certOpts ca.CertOpts) ([]byte, [][]byte, error) {
+	leafAndChain, err := ra.Sign(csrPEM, certOpts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return leafAndChain, [][]byte{ra.keyCertBundle.GetRootCertPem()}, nil
+}
+
+// SignCAServerCert signs the certificate for the Istio CA server itself.
+func (ra *RegistrationAuthority) SignCAServerCert(csrPEM []byte, ttl time.Duration) ([]byte, error) {
+	return ra.Sign(csrPEM, ca.CertOpts{TTL: ttl})
+}
+
+// waitForCertificate polls the named CertificateSigningRequest until it is approved and its
+// status.certificate is populated, or until pollTimeout elapses.
+func (ra *RegistrationAuthority) waitForCertificate(name string) ([]byte, error) {
+	var certPEM []byte
+	err := wait.PollImmediate(pollInterval, pollTimeout, func() (bool, error) {
+		csr, err := ra.csrClient.Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, c := range csr.Status.Conditions {
+			if c.Type == certv1beta1.CertificateDenied || c.Type == certv1beta1.CertificateFailed {
+				return false, fmt.Errorf("CertificateSigningRequest %s was not issued: %s", name, c.Reason)
+			}
+		}
+		if len(csr.Status.Certificate) == 0 {
+			return false, nil
+		}
+		certPEM = csr.Status.Certificate
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("CertificateSigningRequest %s was approved and issued", name)
+	return certPEM, nil
+}
+
+// GetCAKeyCertBundle returns the RA's trust bundle (built from TrustedRootCertPem), so callers
+// that read ca.GetCAKeyCertBundle().GetRootCertPem() keep working. Sign does not check the
+// certificate returned by the external signer against this bundle.
+// The RA has a single trust bundle, so any signerName argument is ignored.
+func (ra *RegistrationAuthority) GetCAKeyCertBundle(signerName ...string) util.KeyCertBundle {
+	return ra.keyCertBundle
+}
+
+func int32Ptr(i int32) *int32 {
+	return &i
+}
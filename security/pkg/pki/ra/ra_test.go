@@ -0,0 +1,100 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ra
+
+import (
+	"testing"
+	"time"
+
+	certv1beta1 "k8s.io/api/certificates/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"istio.io/istio/security/pkg/pki/ca"
+	"istio.io/istio/security/pkg/pki/util"
+)
+
+func testCSR(t *testing.T) []byte {
+	t.Helper()
+	csrPEM, _, err := util.GenCSR(util.CertOptions{Org: "test.istio.io", RSAKeySize: 2048})
+	if err != nil {
+		t.Fatalf("failed to generate test CSR: %v", err)
+	}
+	return csrPEM
+}
+
+func newTestRA(t *testing.T, core *fake.Clientset) *RegistrationAuthority {
+	t.Helper()
+	ra, err := NewRegistrationAuthority(&RegistrationAuthorityOptions{
+		SignerName:         "test-signer",
+		CertSignerDomain:   "example.com",
+		TrustedRootCertPem: []byte("test-root"),
+	}, core.CertificatesV1beta1().CertificateSigningRequests())
+	if err != nil {
+		t.Fatalf("NewRegistrationAuthority() failed: %v", err)
+	}
+	return ra
+}
+
+// approveOnCreate makes every CertificateSigningRequest created against core appear already
+// approved and issued with certPEM, the way an external signer normally would asynchronously.
+func approveOnCreate(core *fake.Clientset, certPEM []byte) {
+	core.PrependReactor("create", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		csr := action.(k8stesting.CreateAction).GetObject().(*certv1beta1.CertificateSigningRequest)
+		csr.Status.Certificate = certPEM
+		return false, nil, nil
+	})
+}
+
+func TestSignReturnsIssuedCertAndDeletesCSR(t *testing.T) {
+	wantCert := []byte("test-certificate")
+	core := fake.NewSimpleClientset()
+	approveOnCreate(core, wantCert)
+	ra := newTestRA(t, core)
+
+	gotCert, err := ra.Sign(testCSR(t), ca.CertOpts{TTL: time.Minute})
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+	if string(gotCert) != string(wantCert) {
+		t.Errorf("Sign() = %q, want %q", gotCert, wantCert)
+	}
+
+	csrs, err := core.CertificatesV1beta1().CertificateSigningRequests().List(metav1.ListOptions{})
+	if err != nil {
+		t.Fatalf("failed to list CertificateSigningRequests: %v", err)
+	}
+	if len(csrs.Items) != 0 {
+		t.Errorf("got %d leftover CertificateSigningRequest(s) after Sign(), want 0", len(csrs.Items))
+	}
+}
+
+func TestSignReturnsErrorOnDenial(t *testing.T) {
+	core := fake.NewSimpleClientset()
+	core.PrependReactor("create", "certificatesigningrequests", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		csr := action.(k8stesting.CreateAction).GetObject().(*certv1beta1.CertificateSigningRequest)
+		csr.Status.Conditions = []certv1beta1.CertificateSigningRequestCondition{
+			{Type: certv1beta1.CertificateDenied, Reason: "test denial"},
+		}
+		return false, nil, nil
+	})
+	ra := newTestRA(t, core)
+
+	if _, err := ra.Sign(testCSR(t), ca.CertOpts{TTL: time.Minute}); err == nil {
+		t.Fatal("Sign() on a denied CertificateSigningRequest: expected error, got none")
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "time"
+
+// SupportedECSignatureAlgorithms is the enum for the supported EC signature algorithms.
+type SupportedECSignatureAlgorithms string
+
+const (
+	// EcdsaSigAlg is the identifier for ECDSA-signed keys, as opposed to the RSA default.
+	EcdsaSigAlg SupportedECSignatureAlgorithms = "ECDSA"
+)
+
+// SupportedEllipticCurves is the enum for the elliptic curves CertOptions.ECCCurve accepts.
+type SupportedEllipticCurves string
+
+const (
+	// P256Curve is the NIST P-256 curve.
+	P256Curve SupportedEllipticCurves = "P256"
+	// P384Curve is the NIST P-384 curve.
+	P384Curve SupportedEllipticCurves = "P384"
+)
+
+// CertOptions holds the options for generating a self-signed certificate/key pair, or a CSR
+// and its accompanying key.
+type CertOptions struct {
+	// Host is a comma-separated hostname(s) to appear in cert SANs.
+	Host string
+
+	// Org is the organization of the cert.
+	Org string
+
+	// TTL is the cert validity duration.
+	TTL time.Duration
+
+	// NotBefore is the cert's NotBefore; the zero value means "now" to callers that generate
+	// the cert immediately.
+	NotBefore time.Time
+
+	// IsCA indicates whether the generated cert is a CA cert.
+	IsCA bool
+
+	// IsSelfSigned marks options for a self-signed cert. GenCertKeyFromOptions always produces a
+	// self-signed cert and GenCSR ignores this field.
+	IsSelfSigned bool
+
+	// RSAKeySize is the RSA key size used when ECSigAlg is unset.
+	RSAKeySize int
+
+	// ECSigAlg selects an EC key algorithm instead of RSA when set.
+	ECSigAlg SupportedECSignatureAlgorithms
+
+	// ECCCurve selects the curve to use when ECSigAlg is EcdsaSigAlg. Defaults to P256Curve.
+	ECCCurve SupportedEllipticCurves
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// genKeyFromOptions generates a private key following options, defaulting to RSA when ECSigAlg
+// is unset.
+func genKeyFromOptions(options CertOptions) (crypto.Signer, error) {
+	if options.ECSigAlg == EcdsaSigAlg {
+		curve := elliptic.P256()
+		if options.ECCCurve == P384Curve {
+			curve = elliptic.P384()
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	}
+	keySize := options.RSAKeySize
+	if keySize == 0 {
+		keySize = 2048
+	}
+	return rsa.GenerateKey(rand.Reader, keySize)
+}
+
+// marshalPrivateKey PEM-encodes a generated private key.
+func marshalPrivateKey(priv crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal private key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// GenCertKeyFromOptions generates a self-signed certificate and key pair according to options.
+func GenCertKeyFromOptions(options CertOptions) (pemCert []byte, pemKey []byte, err error) {
+	priv, err := genKeyFromOptions(options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	notBefore := options.NotBefore
+	if notBefore.IsZero() {
+		notBefore = time.Now()
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{options.Org}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(options.TTL),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  options.IsCA,
+	}
+	if options.Host != "" {
+		template.DNSNames = strings.Split(options.Host, ",")
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create self-signed certificate: %v", err)
+	}
+	pemCert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	if pemKey, err = marshalPrivateKey(priv); err != nil {
+		return nil, nil, err
+	}
+	return pemCert, pemKey, nil
+}
+
+// GenCSR generates a PEM-encoded CSR and its accompanying private key according to options.
+func GenCSR(options CertOptions) (csrPEM []byte, privPEM []byte, err error) {
+	priv, err := genKeyFromOptions(options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate private key: %v", err)
+	}
+
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{Organization: []string{options.Org}},
+	}
+	if options.Host != "" {
+		template.DNSNames = strings.Split(options.Host, ",")
+	}
+
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, template, priv)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CSR: %v", err)
+	}
+	csrPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	if privPEM, err = marshalPrivateKey(priv); err != nil {
+		return nil, nil, err
+	}
+	return csrPEM, privPEM, nil
+}
+
+// ParsePemEncodedCSR parses a PEM-encoded CSR into an x509.CertificateRequest.
+func ParsePemEncodedCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM-encoded CSR")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR: %v", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("CSR signature check failed: %v", err)
+	}
+	return csr, nil
+}
+
+// VerifySubjectIDs checks that every identity in subjectIDs appears among csr's URI SANs,
+// letting a signer reject a CSR whose caller-asserted identity (e.g. from the transport's peer
+// certificate) was not actually embedded in the CSR. A nil or empty subjectIDs is always valid.
+func VerifySubjectIDs(csr *x509.CertificateRequest, subjectIDs []string) error {
+	if len(subjectIDs) == 0 {
+		return nil
+	}
+
+	csrIDs := make(map[string]bool, len(csr.URIs))
+	for _, uri := range csr.URIs {
+		csrIDs[uri.String()] = true
+	}
+	for _, id := range subjectIDs {
+		if !csrIDs[id] {
+			return fmt.Errorf("CSR does not contain expected subject ID %q", id)
+		}
+	}
+	return nil
+}
+
+// GenCertFromCSR signs csr with signingKey/signingCert, returning the DER-encoded certificate.
+// notBefore lets callers backdate the issued certificate (e.g. to tolerate workload clock skew);
+// pass time.Now() for no backdating.
+func GenCertFromCSR(csr *x509.CertificateRequest, signingCert *x509.Certificate, publicKey crypto.PublicKey,
+	signingKey crypto.PrivateKey, notBefore time.Time, ttl time.Duration, forCA bool) ([]byte, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	var extKeyUsage []x509.ExtKeyUsage
+	if forCA {
+		keyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		extKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth}
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               csr.Subject,
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(ttl),
+		KeyUsage:              keyUsage,
+		ExtKeyUsage:           extKeyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  forCA,
+		DNSNames:              csr.DNSNames,
+		IPAddresses:           csr.IPAddresses,
+		EmailAddresses:        csr.EmailAddresses,
+		URIs:                  csr.URIs,
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, signingCert, publicKey, signingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign certificate: %v", err)
+	}
+	return certDER, nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+)
+
+// KeyCertBundle stores the cert/key material a CA or RA signs with and/or presents as its
+// trust bundle.
+type KeyCertBundle interface {
+	// GetAll returns the signing cert, signing key, cert chain PEM and root cert PEM. Either
+	// of the first two may be nil for a bundle that only holds a trust root (e.g. the RA's).
+	GetAll() (cert *x509.Certificate, privKey *crypto.PrivateKey, certChainPem []byte, rootCertPem []byte)
+	// GetRootCertPem returns the PEM-encoded trust root.
+	GetRootCertPem() []byte
+	// GetCertChainPem returns the PEM-encoded issuing chain (intermediates), if any.
+	GetCertChainPem() []byte
+}
+
+type keyCertBundleImpl struct {
+	cert         *x509.Certificate
+	privKey      *crypto.PrivateKey
+	certChainPem []byte
+	rootCertPem  []byte
+}
+
+func (b *keyCertBundleImpl) GetAll() (*x509.Certificate, *crypto.PrivateKey, []byte, []byte) {
+	return b.cert, b.privKey, b.certChainPem, b.rootCertPem
+}
+
+func (b *keyCertBundleImpl) GetRootCertPem() []byte {
+	return b.rootCertPem
+}
+
+func (b *keyCertBundleImpl) GetCertChainPem() []byte {
+	return b.certChainPem
+}
+
+// NewVerifiedKeyCertBundleFromPem builds a KeyCertBundle from PEM bytes and verifies that
+// certPem (when given) chains up to rootCertPem. certPem/keyPem may both be nil for a
+// trust-only bundle (e.g. a RegistrationAuthority that never signs locally).
+func NewVerifiedKeyCertBundleFromPem(certPem, keyPem, certChainPem, rootCertPem []byte) (KeyCertBundle, error) {
+	bundle := &keyCertBundleImpl{
+		certChainPem: certChainPem,
+		rootCertPem:  rootCertPem,
+	}
+
+	if len(certPem) == 0 {
+		return bundle, nil
+	}
+
+	certBlock, _ := pem.Decode(certPem)
+	if certBlock == nil {
+		return nil, fmt.Errorf("failed to decode PEM-encoded certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+	bundle.cert = cert
+
+	if len(rootCertPem) > 0 {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(rootCertPem) {
+			return nil, fmt.Errorf("failed to parse root certificate")
+		}
+		intermediates := x509.NewCertPool()
+		if len(certChainPem) > 0 {
+			intermediates.AppendCertsFromPEM(certChainPem)
+		}
+		if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+			return nil, fmt.Errorf("certificate does not chain to the given root: %v", err)
+		}
+	}
+
+	if len(keyPem) > 0 {
+		keyBlock, _ := pem.Decode(keyPem)
+		if keyBlock == nil {
+			return nil, fmt.Errorf("failed to decode PEM-encoded private key")
+		}
+		key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %v", err)
+		}
+		privKey := crypto.PrivateKey(key)
+		bundle.privKey = &privKey
+	}
+
+	return bundle, nil
+}
+
+// NewVerifiedKeyCertBundleFromFile is the file-backed counterpart to
+// NewVerifiedKeyCertBundleFromPem. certChainFile may be empty when there is no issuing chain.
+func NewVerifiedKeyCertBundleFromFile(signingCertFile, signingKeyFile, certChainFile, rootCertFile string) (KeyCertBundle, error) {
+	certPem, err := ioutil.ReadFile(signingCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing cert file %s: %v", signingCertFile, err)
+	}
+	keyPem, err := ioutil.ReadFile(signingKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key file %s: %v", signingKeyFile, err)
+	}
+	var certChainPem []byte
+	if certChainFile != "" {
+		if certChainPem, err = ioutil.ReadFile(certChainFile); err != nil {
+			return nil, fmt.Errorf("failed to read cert chain file %s: %v", certChainFile, err)
+		}
+	}
+	rootCertPem, err := ioutil.ReadFile(rootCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read root cert file %s: %v", rootCertFile, err)
+	}
+	return NewVerifiedKeyCertBundleFromPem(certPem, keyPem, certChainPem, rootCertPem)
+}
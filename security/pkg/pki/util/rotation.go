@@ -0,0 +1,42 @@
+// Copyright 2017 Istio Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+// IsWithinGracePeriod reports whether rootCertPem has entered its rotation grace period, i.e.
+// the fraction of its remaining lifetime is at or below gracePeriodRatio.
+func IsWithinGracePeriod(rootCertPem []byte, gracePeriodRatio float64) (bool, error) {
+	block, _ := pem.Decode(rootCertPem)
+	if block == nil {
+		return false, fmt.Errorf("failed to decode PEM-encoded root certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse root certificate: %v", err)
+	}
+
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	if lifetime <= 0 {
+		return true, nil
+	}
+	remaining := time.Until(cert.NotAfter)
+	return float64(remaining) <= float64(lifetime)*gracePeriodRatio, nil
+}